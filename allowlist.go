@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// AllowListEntry is one persisted-query record: a content-addressed hash of
+// the normalized query, a human-assigned name, the original query text as
+// written, and its parsed JSON.
+type AllowListEntry struct {
+	Hash     string      `json:"hash"`
+	Name     string      `json:"name"`
+	Original string      `json:"original"`
+	Parsed   ParsedQuery `json:"parsed"`
+}
+
+// QueryHash normalizes query (flattening, deduping, and canonically
+// sorting its tree) and returns a stable hex-encoded hash of its JSON
+// along with the normalized ParsedQuery itself. Two queries that are
+// semantically equal, however differently written, hash the same.
+func QueryHash(query string) (string, *ParsedQuery, error) {
+	node, err := Compile(query)
+	if err != nil {
+		return "", nil, err
+	}
+	pq := parsedQueryFromNode(Normalize(node, NormalizeFlatten))
+
+	body, err := json.Marshal(pq)
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), pq, nil
+}
+
+// loadAllowList reads an allow-list file (one JSON AllowListEntry per
+// line) into a map keyed by hash. A missing file is treated as empty.
+func loadAllowList(path string) (map[string]AllowListEntry, error) {
+	entries := make(map[string]AllowListEntry)
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening allow-list %q: %v", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry AllowListEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("error parsing allow-list %q: %v", path, err)
+		}
+		entries[entry.Hash] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading allow-list %q: %v", path, err)
+	}
+	return entries, nil
+}
+
+// saveAllowList writes an allow-list's entries back out, one JSON object
+// per line sorted by hash so the file stays diffable across runs.
+func saveAllowList(path string, entries map[string]AllowListEntry) error {
+	hashes := make([]string, 0, len(entries))
+	for hash := range entries {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating allow-list %q: %v", path, err)
+	}
+	defer file.Close()
+
+	encoder := json.NewEncoder(file)
+	for _, hash := range hashes {
+		if err := encoder.Encode(entries[hash]); err != nil {
+			return fmt.Errorf("error writing allow-list %q: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// runAllowlist implements the `allowlist` subcommand: it ingests an SDG
+// query file, hashes each normalized query, and upserts the result into
+// an allow-list file. Re-ingesting a query that is already listed keeps
+// its existing name rather than renaming it.
+func runAllowlist(args []string) error {
+	fs := flag.NewFlagSet("allowlist", flag.ExitOnError)
+	outPath := fs.String("out", "allow.list", "path to the allow-list file to write/update")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: allowlist [-out=allow.list] <input_file.txt>")
+	}
+	inputPath := fs.Arg(0)
+
+	entries, err := loadAllowList(*outPath)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("error opening input file: %v", err)
+	}
+	defer file.Close()
+
+	added, updated := 0, 0
+	lineNumber := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		hash, pq, err := QueryHash(line)
+		if err != nil {
+			fmt.Printf("Warning: Error processing line %d: %v\n", lineNumber, err)
+			continue
+		}
+
+		name := fmt.Sprintf("query-%d", lineNumber)
+		if existing, ok := entries[hash]; ok {
+			name = existing.Name
+			updated++
+		} else {
+			added++
+		}
+		entries[hash] = AllowListEntry{Hash: hash, Name: name, Original: line, Parsed: *pq}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading input file: %v", err)
+	}
+
+	if err := saveAllowList(*outPath, entries); err != nil {
+		return err
+	}
+
+	fmt.Printf("Allow-list %q: %d added, %d already present, %d total.\n", *outPath, added, updated, len(entries))
+	return nil
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Node is one node of a parsed query's expression tree. It can evaluate
+// itself against a document (a set of field -> values) and render itself
+// back out as a readable string. ParsedQuery remains the JSON wire shape;
+// Node is the in-memory representation used to validate, compose, and
+// manipulate queries in Go code.
+type Node interface {
+	Eval(doc map[string][]string) bool
+	String() string
+}
+
+// AndNode requires every child to match.
+type AndNode struct {
+	Children []Node
+}
+
+func (n *AndNode) Eval(doc map[string][]string) bool {
+	for _, child := range n.Children {
+		if !child.Eval(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *AndNode) String() string {
+	return joinNodes(n.Children, " AND ")
+}
+
+func (n *AndNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(parsedQueryFromNode(n))
+}
+
+// OrNode requires at least one child to match.
+type OrNode struct {
+	Children []Node
+}
+
+func (n *OrNode) Eval(doc map[string][]string) bool {
+	for _, child := range n.Children {
+		if child.Eval(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *OrNode) String() string {
+	return "(" + joinNodes(n.Children, " OR ") + ")"
+}
+
+func (n *OrNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(parsedQueryFromNode(n))
+}
+
+// NotNode negates its single child.
+type NotNode struct {
+	Child Node
+}
+
+func (n *NotNode) Eval(doc map[string][]string) bool {
+	return n.Child != nil && !n.Child.Eval(doc)
+}
+
+func (n *NotNode) String() string {
+	if n.Child == nil {
+		return "AND_NOT"
+	}
+	return "AND_NOT " + n.Child.String()
+}
+
+func (n *NotNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(parsedQueryFromNode(n))
+}
+
+// FieldNode matches a document field against a value. Op selects the
+// comparison: empty for equality (e.g. TITLE-ABS-KEY("machine learning")),
+// one of ">" "<" ">=" "<=" "=" for a PUBYEAR-style range, "near" for an
+// unordered W/N proximity match, or "pre" for an ordered PRE/N proximity
+// match, both within Distance words. An equality Value containing "*" or
+// "?" is matched as a wildcard glob rather than a literal string.
+type FieldNode struct {
+	Field    string
+	Value    string
+	Op       string
+	Distance int
+}
+
+func (n *FieldNode) Eval(doc map[string][]string) bool {
+	switch n.Op {
+	case "":
+		return evalEquality(doc[n.Field], n.Value)
+	case "near":
+		return evalProximity(doc[n.Field], n.Value, n.Distance, false)
+	case "pre":
+		return evalProximity(doc[n.Field], n.Value, n.Distance, true)
+	default:
+		want, err := strconv.Atoi(n.Value)
+		if err != nil {
+			return false
+		}
+		for _, v := range doc[n.Field] {
+			got, err := strconv.Atoi(v)
+			if err != nil {
+				continue
+			}
+			if compareNumeric(got, n.Op, want) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// evalEquality matches values against pattern, treating "*" (any run of
+// characters) and "?" (any single character) in pattern as wildcards when
+// present, or an exact case-insensitive comparison otherwise.
+func evalEquality(values []string, pattern string) bool {
+	if !strings.ContainsAny(pattern, "*?") {
+		for _, v := range values {
+			if strings.EqualFold(v, pattern) {
+				return true
+			}
+		}
+		return false
+	}
+	re := wildcardToRegexp(pattern)
+	for _, v := range values {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardToRegexp compiles an SDG wildcard pattern ("*" any run, "?" any
+// one character, everything else literal) into an anchored, case-
+// insensitive regexp.
+func wildcardToRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// evalProximity reports whether phrase's words all occur within a window
+// of distance words of each other in some value: in any order for W/N
+// (ordered=false), or in the order written for PRE/N (ordered=true). A
+// single-word phrase falls back to evalEquality.
+func evalProximity(values []string, phrase string, distance int, ordered bool) bool {
+	needles := strings.Fields(phrase)
+	if len(needles) < 2 {
+		return evalEquality(values, phrase)
+	}
+
+	for _, v := range values {
+		if proximityWindow(strings.Fields(v), needles, distance, ordered) {
+			return true
+		}
+	}
+	return false
+}
+
+// proximityWindow reports whether docWords contains, for every word in
+// needles, some occurrence such that the spread between the earliest and
+// latest chosen occurrence is at most distance. When ordered is true, the
+// chosen occurrences must also appear in the same order as needles.
+func proximityWindow(docWords, needles []string, distance int, ordered bool) bool {
+	positions := make([][]int, len(needles))
+	for i, needle := range needles {
+		for idx, w := range docWords {
+			if strings.EqualFold(w, needle) {
+				positions[i] = append(positions[i], idx)
+			}
+		}
+		if len(positions[i]) == 0 {
+			return false
+		}
+	}
+
+	chosen := make([]int, len(positions))
+	var search func(i int) bool
+	search = func(i int) bool {
+		if i == len(positions) {
+			min, max := chosen[0], chosen[0]
+			for _, idx := range chosen {
+				if idx < min {
+					min = idx
+				}
+				if idx > max {
+					max = idx
+				}
+			}
+			return max-min <= distance
+		}
+		for _, p := range positions[i] {
+			if ordered && i > 0 && p <= chosen[i-1] {
+				continue
+			}
+			chosen[i] = p
+			if search(i + 1) {
+				return true
+			}
+		}
+		return false
+	}
+	return search(0)
+}
+
+func compareNumeric(got int, op string, want int) bool {
+	switch op {
+	case ">":
+		return got > want
+	case "<":
+		return got < want
+	case ">=":
+		return got >= want
+	case "<=":
+		return got <= want
+	case "=":
+		return got == want
+	default:
+		return false
+	}
+}
+
+func (n *FieldNode) String() string {
+	switch n.Op {
+	case "":
+		return fmt.Sprintf("%s:%q", n.Field, n.Value)
+	case "near":
+		return fmt.Sprintf("%s:%q W/%d", n.Field, n.Value, n.Distance)
+	case "pre":
+		return fmt.Sprintf("%s:%q PRE/%d", n.Field, n.Value, n.Distance)
+	default:
+		return fmt.Sprintf("%s %s %s", n.Field, n.Op, n.Value)
+	}
+}
+
+func (n *FieldNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(parsedQueryFromNode(n))
+}
+
+// PhraseNode matches free text against any field's values (the "ANY" field
+// produced by quoted, unqualified terms).
+type PhraseNode struct {
+	Phrase string
+}
+
+func (n *PhraseNode) Eval(doc map[string][]string) bool {
+	needle := strings.ToLower(n.Phrase)
+	for _, values := range doc {
+		for _, v := range values {
+			if strings.Contains(strings.ToLower(v), needle) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (n *PhraseNode) String() string {
+	return fmt.Sprintf("%q", n.Phrase)
+}
+
+func (n *PhraseNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(parsedQueryFromNode(n))
+}
+
+// RegexpNode matches a field's values against a compiled pattern. Compile
+// does not emit it yet, but future leaf shapes (wildcards, ranges) can
+// target it without another change to the JSON layer.
+type RegexpNode struct {
+	Field   string
+	Pattern string
+}
+
+func (n *RegexpNode) Eval(doc map[string][]string) bool {
+	re, err := regexp.Compile(n.Pattern)
+	if err != nil {
+		return false
+	}
+	for _, v := range doc[n.Field] {
+		if re.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *RegexpNode) String() string {
+	return fmt.Sprintf("%s~/%s/", n.Field, n.Pattern)
+}
+
+func (n *RegexpNode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(parsedQueryFromNode(n))
+}
+
+func joinNodes(nodes []Node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.String()
+	}
+	return strings.Join(parts, sep)
+}
+
+// Compile parses an SDG-style query string directly into an expression tree.
+func Compile(query string) (Node, error) {
+	tokens, badPos := tokenize(query)
+	parsedQuery := parseTokens(tokens)
+	if isEmptyQuery(parsedQuery) {
+		if badPos > 0 {
+			return nil, &positionedError{message: "query parsed to empty structure", position: badPos}
+		}
+		return nil, fmt.Errorf("query parsed to empty structure")
+	}
+	return nodeFromParsedQuery(parsedQuery), nil
+}
+
+// NodeFromJSON decodes a ParsedQuery-shaped document into an expression
+// tree, the inverse of a node's MarshalJSON.
+func NodeFromJSON(data []byte) (Node, error) {
+	var parsedQuery ParsedQuery
+	if err := json.Unmarshal(data, &parsedQuery); err != nil {
+		return nil, err
+	}
+	return nodeFromParsedQuery(&parsedQuery), nil
+}
+
+// nodeFromParsedQuery converts the JSON-backed ParsedQuery tree into an
+// expression tree. ParsedQuery's AND/OR/AND_NOT arrays can all be populated
+// on the same node; the equivalent tree ANDs the AND children, one OrNode
+// for the OR children, and a NotNode per AND_NOT child together.
+func nodeFromParsedQuery(pq *ParsedQuery) Node {
+	if pq == nil {
+		return nil
+	}
+
+	if pq.Field != nil && len(pq.AND) == 0 && len(pq.OR) == 0 && len(pq.AND_NOT) == 0 {
+		if pq.Field.Field == "ANY" && pq.Field.Op == "" {
+			return &PhraseNode{Phrase: pq.Field.Value}
+		}
+		return &FieldNode{Field: pq.Field.Field, Value: pq.Field.Value, Op: pq.Field.Op, Distance: pq.Field.Distance}
+	}
+
+	var parts []Node
+	for _, sub := range pq.AND {
+		if n := nodeFromParsedQuery(&sub); n != nil {
+			parts = append(parts, n)
+		}
+	}
+	if len(pq.OR) > 0 {
+		var orChildren []Node
+		for _, sub := range pq.OR {
+			if n := nodeFromParsedQuery(&sub); n != nil {
+				orChildren = append(orChildren, n)
+			}
+		}
+		parts = append(parts, &OrNode{Children: orChildren})
+	}
+	for _, sub := range pq.AND_NOT {
+		if n := nodeFromParsedQuery(&sub); n != nil {
+			parts = append(parts, &NotNode{Child: n})
+		}
+	}
+
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return &AndNode{Children: parts}
+}
+
+// parsedQueryFromNode converts an expression tree back into the
+// ParsedQuery shape used for JSON output.
+func parsedQueryFromNode(n Node) *ParsedQuery {
+	switch v := n.(type) {
+	case nil:
+		return nil
+	case *FieldNode:
+		return &ParsedQuery{Field: &Field{Field: v.Field, Value: v.Value, Op: v.Op, Distance: v.Distance}}
+	case *PhraseNode:
+		return &ParsedQuery{Field: &Field{Field: "ANY", Value: v.Phrase}}
+	case *RegexpNode:
+		return &ParsedQuery{Field: &Field{Field: v.Field, Value: v.Pattern}}
+	case *NotNode:
+		pq := &ParsedQuery{}
+		if sub := parsedQueryFromNode(v.Child); sub != nil {
+			pq.AND_NOT = append(pq.AND_NOT, *sub)
+		}
+		return pq
+	case *OrNode:
+		pq := &ParsedQuery{}
+		for _, child := range v.Children {
+			if sub := parsedQueryFromNode(child); sub != nil {
+				pq.OR = append(pq.OR, *sub)
+			}
+		}
+		return pq
+	case *AndNode:
+		// An AndNode can only merge a child OrNode's children straight into
+		// pq.OR when it is the sole OrNode among the AND's children: two or
+		// more would otherwise splice into the same slice and the AND
+		// between them would be lost on serialization. Nest the rest (via
+		// the default case) as ordinary pq.AND entries instead.
+		orCount := 0
+		for _, child := range v.Children {
+			if _, ok := child.(*OrNode); ok {
+				orCount++
+			}
+		}
+
+		pq := &ParsedQuery{}
+		for _, child := range v.Children {
+			switch c := child.(type) {
+			case *NotNode:
+				if sub := parsedQueryFromNode(c.Child); sub != nil {
+					pq.AND_NOT = append(pq.AND_NOT, *sub)
+				}
+			case *OrNode:
+				if orCount == 1 {
+					for _, orChild := range c.Children {
+						if sub := parsedQueryFromNode(orChild); sub != nil {
+							pq.OR = append(pq.OR, *sub)
+						}
+					}
+					continue
+				}
+				if sub := parsedQueryFromNode(c); sub != nil {
+					pq.AND = append(pq.AND, *sub)
+				}
+			default:
+				if sub := parsedQueryFromNode(child); sub != nil {
+					pq.AND = append(pq.AND, *sub)
+				}
+			}
+		}
+		return pq
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+// TestAndMultipleOrChildrenRoundTrip guards against the AndNode/OrNode
+// splicing bug: (A OR B) AND (C OR D) must still only satisfy documents
+// that match both disjunctions, both in-memory and after a JSON round
+// trip through MarshalJSON/NodeFromJSON.
+func TestAndMultipleOrChildrenRoundTrip(t *testing.T) {
+	tree := &AndNode{Children: []Node{
+		&OrNode{Children: []Node{buildField("A", "1"), buildField("B", "1")}},
+		&OrNode{Children: []Node{buildField("C", "1"), buildField("D", "1")}},
+	}}
+
+	onlyFirstClause := docFor("A")
+	if tree.Eval(onlyFirstClause) {
+		t.Fatal("in-memory tree evaluated true when only one OR clause is satisfied")
+	}
+
+	rt := roundTrip(t, tree)
+	if rt.Eval(onlyFirstClause) {
+		t.Fatal("round-tripped tree evaluated true when only one OR clause is satisfied")
+	}
+
+	bothClauses := docFor("A", "C")
+	if !rt.Eval(bothClauses) {
+		t.Fatal("round-tripped tree should evaluate true when both OR clauses are satisfied")
+	}
+}
+
+// TestCompileRoundTrip exercises Compile -> MarshalJSON -> NodeFromJSON
+// -> Eval for a plain SDG query, the path processQuery relies on.
+func TestCompileRoundTrip(t *testing.T) {
+	node, err := Compile(`TITLE("machine learning") AND AUTHKEY("smith")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt := roundTrip(t, node)
+	both := map[string][]string{"TITLE": {"machine learning"}, "AUTHKEY": {"smith"}}
+	if !rt.Eval(both) {
+		t.Fatal("expected round-tripped AND query to match a doc with both fields")
+	}
+	titleOnly := map[string][]string{"TITLE": {"machine learning"}}
+	if rt.Eval(titleOnly) {
+		t.Fatal("expected round-tripped AND query to reject a doc missing one field")
+	}
+}
+
+func TestCompileEmptyQuery(t *testing.T) {
+	if _, err := Compile("@@@"); err == nil {
+		t.Fatal("expected an error for an unparseable query")
+	}
+}
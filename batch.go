@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// lineJob is one input line queued for a worker, tagged with its sequence
+// number (its position among non-blank lines) so results can be written
+// back out in input order despite being processed out of order.
+type lineJob struct {
+	seq        int
+	lineNumber int
+	line       string
+}
+
+// lineOutput is a worker's result for one lineJob. hasItem distinguishes
+// "parsed to nothing, skip silently" (the pre-existing behavior for an
+// empty parsed query) from "produced output". skipped marks a job that
+// was never run because fail-fast had already aborted the batch; it
+// still carries its seq so streamResults can advance past the gap
+// instead of stalling on it forever.
+type lineOutput struct {
+	seq      int
+	hasItem  bool
+	item     interface{}
+	parseErr *ParseError
+	skipped  bool
+}
+
+// processFile parses every query in inputPath through a worker pool and
+// writes the results to a sibling output file, preserving input order.
+// With target "" (or "json", the default) the output is the existing
+// ParsedQuery JSON array; any other target name transpiles each query
+// through the matching Emitter instead. Lines that fail to parse are
+// recorded as ParseError records in a sibling .errors.jsonl file; with
+// failFast, any such failure makes processFile return a non-nil error.
+func processFile(inputPath string, target string, fieldMap FieldMap, workers int, failFast bool) error {
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("error opening input file: %v", err)
+	}
+	defer file.Close()
+
+	var emitter Emitter
+	if target != "" && target != "json" {
+		emitter, err = NewEmitter(target, fieldMap)
+		if err != nil {
+			return err
+		}
+	}
+
+	outputPath := strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + ".json"
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+	defer outputFile.Close()
+
+	errorsPath := strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + ".errors.jsonl"
+	errorsFile, err := os.Create(errorsPath)
+	if err != nil {
+		return fmt.Errorf("error creating errors file: %v", err)
+	}
+	defer errorsFile.Close()
+
+	var jobs []lineJob
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		jobs = append(jobs, lineJob{seq: len(jobs), lineNumber: lineNumber, line: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading input file: %v", err)
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobCh := make(chan lineJob)
+	outCh := make(chan lineOutput)
+	var aborted int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				if failFast && atomic.LoadInt32(&aborted) != 0 {
+					outCh <- lineOutput{seq: job.seq, skipped: true}
+					continue
+				}
+				out := runJob(job, emitter)
+				if out.parseErr != nil && failFast {
+					atomic.StoreInt32(&aborted, 1)
+				}
+				outCh <- out
+			}
+		}()
+	}
+
+	go func() {
+		for _, job := range jobs {
+			jobCh <- job
+		}
+		close(jobCh)
+	}()
+	go func() {
+		wg.Wait()
+		close(outCh)
+	}()
+
+	written, parseErrors, err := streamResults(outputFile, errorsFile, outCh)
+	if err != nil {
+		return err
+	}
+
+	if len(parseErrors) == 0 {
+		errorsFile.Close()
+		os.Remove(errorsPath)
+	}
+
+	fmt.Printf("Successfully processed %d queries (%d errors). Output written to: %s\n", written, len(parseErrors), outputPath)
+
+	if failFast && len(parseErrors) > 0 {
+		return fmt.Errorf("%d line(s) failed to parse, see %s", len(parseErrors), errorsPath)
+	}
+	return nil
+}
+
+// runJob parses (and, with an emitter, transpiles) a single line.
+func runJob(job lineJob, emitter Emitter) lineOutput {
+	out := lineOutput{seq: job.seq}
+
+	if emitter != nil {
+		node, err := Compile(job.line)
+		if err != nil {
+			out.parseErr = newParseError(job.lineNumber, job.line, err)
+			return out
+		}
+		result, err := emitter.Emit(node)
+		if err != nil {
+			out.parseErr = newParseError(job.lineNumber, job.line, err)
+			return out
+		}
+		out.hasItem, out.item = true, result
+		return out
+	}
+
+	parsedQuery, err := processQuery(job.line)
+	if err != nil {
+		out.parseErr = newParseError(job.lineNumber, job.line, err)
+		return out
+	}
+	if !isEmptyQuery(parsedQuery) {
+		out.hasItem, out.item = true, *parsedQuery
+	}
+	return out
+}
+
+// streamResults consumes worker output as it arrives, holding only the
+// results still out of order in memory, and writes each JSON array
+// element to outputFile as soon as its turn comes up rather than
+// buffering the whole result set. Failures are appended to errorsFile as
+// they're encountered.
+func streamResults(outputFile, errorsFile *os.File, outCh <-chan lineOutput) (written int, parseErrors []*ParseError, err error) {
+	errEncoder := json.NewEncoder(errorsFile)
+
+	if _, err = outputFile.WriteString("["); err != nil {
+		return 0, nil, err
+	}
+
+	pending := make(map[int]lineOutput)
+	next := 0
+	first := true
+
+	flushReady := func() error {
+		for {
+			out, ok := pending[next]
+			if !ok {
+				return nil
+			}
+			delete(pending, next)
+			next++
+
+			if out.skipped {
+				continue
+			}
+			if out.parseErr != nil {
+				parseErrors = append(parseErrors, out.parseErr)
+				if err := errEncoder.Encode(out.parseErr); err != nil {
+					return err
+				}
+				continue
+			}
+			if !out.hasItem {
+				continue
+			}
+
+			if !first {
+				if _, err := outputFile.WriteString(","); err != nil {
+					return err
+				}
+			}
+			first = false
+			written++
+
+			if _, err := outputFile.WriteString("\n  "); err != nil {
+				return err
+			}
+			b, err := json.MarshalIndent(out.item, "  ", "  ")
+			if err != nil {
+				return err
+			}
+			if _, err := outputFile.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+
+	for out := range outCh {
+		pending[out.seq] = out
+		if err := flushReady(); err != nil {
+			return written, parseErrors, fmt.Errorf("error writing JSON to file: %v", err)
+		}
+	}
+
+	if !first {
+		if _, err := outputFile.WriteString("\n"); err != nil {
+			return written, parseErrors, err
+		}
+	}
+	if _, err := outputFile.WriteString("]\n"); err != nil {
+		return written, parseErrors, err
+	}
+
+	return written, parseErrors, nil
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// isWildcard reports whether a field value contains a `*`/`?` wildcard,
+// which several emitters render as a dedicated wildcard query instead of
+// an exact match.
+func isWildcard(value string) bool {
+	return strings.ContainsAny(value, "*?")
+}
+
+// FieldMap maps a query field name (e.g. "TITLE-ABS-KEY") to the backend
+// field(s) it should expand to (e.g. ["title", "abstract", "keywords"]).
+// A field with several targets is OR'd across all of them; an unmapped
+// field falls back to its own name, lowercased.
+type FieldMap map[string][]string
+
+// defaultFieldMap covers the fields the SDG tokenizer already understands,
+// plus "ANY" for unqualified free text.
+func defaultFieldMap() FieldMap {
+	return FieldMap{
+		"TITLE-ABS-KEY": {"title", "abstract", "keywords"},
+		"TITLE-ABS":     {"title", "abstract"},
+		"TITLE":         {"title"},
+		"AUTHKEY":       {"author"},
+		"ANY":           {"_all"},
+	}
+}
+
+// LoadFieldMap reads a field mapping from a JSON config file, falling back
+// to defaultFieldMap for any field the file doesn't mention. An empty path
+// returns defaultFieldMap unchanged.
+func LoadFieldMap(path string) (FieldMap, error) {
+	fm := defaultFieldMap()
+	if path == "" {
+		return fm, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading field map %q: %v", path, err)
+	}
+
+	var overrides FieldMap
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("error parsing field map %q: %v", path, err)
+	}
+	for field, targets := range overrides {
+		fm[field] = targets
+	}
+	return fm, nil
+}
+
+func (fm FieldMap) targets(field string) []string {
+	if targets, ok := fm[field]; ok {
+		return targets
+	}
+	return []string{strings.ToLower(field)}
+}
+
+// EmitResult is what an Emitter produces for one query: a backend-native
+// query (JSON or query-language string) plus, for parameterized backends
+// like SQL, the positional arguments that go with it.
+type EmitResult struct {
+	Query string        `json:"query"`
+	Args  []interface{} `json:"args,omitempty"`
+}
+
+// Emitter transpiles a parsed query's expression tree into a target
+// search/query backend.
+type Emitter interface {
+	Emit(node Node) (EmitResult, error)
+}
+
+// NewEmitter returns the Emitter registered for a -target flag value, or an
+// error if the target is unknown.
+func NewEmitter(target string, fm FieldMap) (Emitter, error) {
+	switch target {
+	case "elasticsearch":
+		return &ElasticsearchEmitter{FieldMap: fm}, nil
+	case "lucene":
+		return &LuceneEmitter{FieldMap: fm}, nil
+	case "sql":
+		return &SQLEmitter{FieldMap: fm}, nil
+	case "bleve":
+		return &BleveEmitter{FieldMap: fm}, nil
+	default:
+		return nil, fmt.Errorf("unknown emit target %q", target)
+	}
+}
+
+// --- Elasticsearch -------------------------------------------------
+
+// ElasticsearchEmitter renders a Node tree as Elasticsearch Query DSL
+// (bool/must/should/must_not with match/term leaves).
+type ElasticsearchEmitter struct {
+	FieldMap FieldMap
+}
+
+func (e *ElasticsearchEmitter) Emit(node Node) (EmitResult, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": esNode(node, e.FieldMap)})
+	if err != nil {
+		return EmitResult{}, err
+	}
+	return EmitResult{Query: string(body)}, nil
+}
+
+func esNode(node Node, fm FieldMap) map[string]interface{} {
+	switch n := node.(type) {
+	case *AndNode:
+		return map[string]interface{}{"bool": map[string]interface{}{"must": esNodes(n.Children, fm)}}
+	case *OrNode:
+		return map[string]interface{}{"bool": map[string]interface{}{"should": esNodes(n.Children, fm), "minimum_should_match": 1}}
+	case *NotNode:
+		return map[string]interface{}{"bool": map[string]interface{}{"must_not": []interface{}{esNode(n.Child, fm)}}}
+	case *FieldNode:
+		return esField(n, fm)
+	case *PhraseNode:
+		return map[string]interface{}{"query_string": map[string]interface{}{"query": n.Phrase}}
+	case *RegexpNode:
+		return map[string]interface{}{"regexp": map[string]interface{}{fm.targets(n.Field)[0]: n.Pattern}}
+	default:
+		return map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+}
+
+var esRangeOp = map[string]string{">": "gt", "<": "lt", ">=": "gte", "<=": "lte", "=": "eq"}
+
+func esField(n *FieldNode, fm FieldMap) map[string]interface{} {
+	fields := fm.targets(n.Field)
+	switch n.Op {
+	case "near", "pre":
+		return esMatchPhrase(fields, n.Value, n.Distance)
+	case ">", "<", ">=", "<=":
+		return map[string]interface{}{"range": map[string]interface{}{fields[0]: map[string]interface{}{esRangeOp[n.Op]: n.Value}}}
+	case "=":
+		return esMatch(fields, n.Value)
+	default:
+		if isWildcard(n.Value) {
+			return esWildcard(fields, n.Value)
+		}
+		return esMatch(fields, n.Value)
+	}
+}
+
+func esMatch(fields []string, value string) map[string]interface{} {
+	if len(fields) == 1 {
+		return map[string]interface{}{"match": map[string]interface{}{fields[0]: value}}
+	}
+	should := make([]interface{}, len(fields))
+	for i, f := range fields {
+		should[i] = map[string]interface{}{"match": map[string]interface{}{f: value}}
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"should": should, "minimum_should_match": 1}}
+}
+
+func esMatchPhrase(fields []string, value string, distance int) map[string]interface{} {
+	if len(fields) == 1 {
+		return map[string]interface{}{"match_phrase": map[string]interface{}{fields[0]: map[string]interface{}{"query": value, "slop": distance}}}
+	}
+	should := make([]interface{}, len(fields))
+	for i, f := range fields {
+		should[i] = map[string]interface{}{"match_phrase": map[string]interface{}{f: map[string]interface{}{"query": value, "slop": distance}}}
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"should": should, "minimum_should_match": 1}}
+}
+
+func esWildcard(fields []string, value string) map[string]interface{} {
+	if len(fields) == 1 {
+		return map[string]interface{}{"wildcard": map[string]interface{}{fields[0]: value}}
+	}
+	should := make([]interface{}, len(fields))
+	for i, f := range fields {
+		should[i] = map[string]interface{}{"wildcard": map[string]interface{}{f: value}}
+	}
+	return map[string]interface{}{"bool": map[string]interface{}{"should": should, "minimum_should_match": 1}}
+}
+
+func esNodes(nodes []Node, fm FieldMap) []interface{} {
+	out := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		out[i] = esNode(n, fm)
+	}
+	return out
+}
+
+// --- Lucene ----------------------------------------------------------
+
+// LuceneEmitter renders a Node tree as classic Lucene query syntax.
+type LuceneEmitter struct {
+	FieldMap FieldMap
+}
+
+func (e *LuceneEmitter) Emit(node Node) (EmitResult, error) {
+	return EmitResult{Query: luceneNode(node, e.FieldMap)}, nil
+}
+
+func luceneNode(node Node, fm FieldMap) string {
+	switch n := node.(type) {
+	case *AndNode:
+		return "(" + strings.Join(luceneNodes(n.Children, fm), " AND ") + ")"
+	case *OrNode:
+		return "(" + strings.Join(luceneNodes(n.Children, fm), " OR ") + ")"
+	case *NotNode:
+		return "NOT " + luceneNode(n.Child, fm)
+	case *FieldNode:
+		return luceneField(n, fm)
+	case *PhraseNode:
+		return fmt.Sprintf(`"%s"`, n.Phrase)
+	case *RegexpNode:
+		return fmt.Sprintf(`%s:/%s/`, fm.targets(n.Field)[0], n.Pattern)
+	default:
+		return ""
+	}
+}
+
+func luceneField(n *FieldNode, fm FieldMap) string {
+	fields := fm.targets(n.Field)
+	terms := make([]string, len(fields))
+	for i, f := range fields {
+		switch n.Op {
+		case "near", "pre":
+			terms[i] = fmt.Sprintf(`%s:"%s"~%d`, f, n.Value, n.Distance)
+		case ">", ">=":
+			terms[i] = fmt.Sprintf("%s:[%s TO *]", f, n.Value)
+		case "<", "<=":
+			terms[i] = fmt.Sprintf("%s:[* TO %s]", f, n.Value)
+		case "=":
+			terms[i] = fmt.Sprintf("%s:%s", f, n.Value)
+		default:
+			if isWildcard(n.Value) {
+				terms[i] = fmt.Sprintf("%s:%s", f, n.Value)
+			} else {
+				terms[i] = fmt.Sprintf(`%s:"%s"`, f, n.Value)
+			}
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+func luceneNodes(nodes []Node, fm FieldMap) []string {
+	out := make([]string, len(nodes))
+	for i, n := range nodes {
+		out[i] = luceneNode(n, fm)
+	}
+	return out
+}
+
+// --- SQL ---------------------------------------------------------------
+
+// SQLEmitter renders a Node tree as a parameterized SQL WHERE clause.
+type SQLEmitter struct {
+	FieldMap FieldMap
+}
+
+func (e *SQLEmitter) Emit(node Node) (EmitResult, error) {
+	var args []interface{}
+	clause := sqlNode(node, e.FieldMap, &args)
+	return EmitResult{Query: clause, Args: args}, nil
+}
+
+func sqlNode(node Node, fm FieldMap, args *[]interface{}) string {
+	switch n := node.(type) {
+	case *AndNode:
+		return "(" + strings.Join(sqlNodes(n.Children, fm, args), " AND ") + ")"
+	case *OrNode:
+		return "(" + strings.Join(sqlNodes(n.Children, fm, args), " OR ") + ")"
+	case *NotNode:
+		return "NOT " + sqlNode(n.Child, fm, args)
+	case *FieldNode:
+		return sqlField(n, fm, args)
+	case *PhraseNode:
+		*args = append(*args, "%"+n.Phrase+"%")
+		return "text LIKE ?"
+	case *RegexpNode:
+		*args = append(*args, n.Pattern)
+		return fmt.Sprintf("%s REGEXP ?", fm.targets(n.Field)[0])
+	default:
+		return "1=1"
+	}
+}
+
+func sqlField(n *FieldNode, fm FieldMap, args *[]interface{}) string {
+	fields := fm.targets(n.Field)
+	terms := make([]string, len(fields))
+	for i, f := range fields {
+		switch n.Op {
+		case ">", "<", ">=", "<=":
+			terms[i] = fmt.Sprintf("%s %s ?", f, n.Op)
+			*args = append(*args, n.Value)
+		case "near", "pre":
+			terms[i] = fmt.Sprintf("%s LIKE ?", f)
+			*args = append(*args, "%"+n.Value+"%")
+		default:
+			if isWildcard(n.Value) {
+				terms[i] = fmt.Sprintf("%s LIKE ?", f)
+				*args = append(*args, strings.NewReplacer("*", "%", "?", "_").Replace(n.Value))
+			} else {
+				terms[i] = fmt.Sprintf("%s = ?", f)
+				*args = append(*args, n.Value)
+			}
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+func sqlNodes(nodes []Node, fm FieldMap, args *[]interface{}) []string {
+	out := make([]string, len(nodes))
+	for i, n := range nodes {
+		out[i] = sqlNode(n, fm, args)
+	}
+	return out
+}
+
+// --- Bleve -------------------------------------------------------------
+
+// BleveEmitter renders a Node tree as the JSON shape of Bleve's
+// conjunction/disjunction/boolean query DSL.
+type BleveEmitter struct {
+	FieldMap FieldMap
+}
+
+func (e *BleveEmitter) Emit(node Node) (EmitResult, error) {
+	body, err := json.Marshal(bleveNode(node, e.FieldMap))
+	if err != nil {
+		return EmitResult{}, err
+	}
+	return EmitResult{Query: string(body)}, nil
+}
+
+func bleveNode(node Node, fm FieldMap) map[string]interface{} {
+	switch n := node.(type) {
+	case *AndNode:
+		return map[string]interface{}{"conjuncts": bleveNodes(n.Children, fm)}
+	case *OrNode:
+		return map[string]interface{}{"disjuncts": bleveNodes(n.Children, fm)}
+	case *NotNode:
+		return map[string]interface{}{"must_not": map[string]interface{}{"disjuncts": []interface{}{bleveNode(n.Child, fm)}}}
+	case *FieldNode:
+		return bleveField(n, fm)
+	case *PhraseNode:
+		return map[string]interface{}{"match_phrase": n.Phrase}
+	case *RegexpNode:
+		return map[string]interface{}{"regexp": n.Pattern, "field": fm.targets(n.Field)[0]}
+	default:
+		return map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+}
+
+func bleveField(n *FieldNode, fm FieldMap) map[string]interface{} {
+	fields := fm.targets(n.Field)
+
+	switch n.Op {
+	case ">", ">=":
+		return map[string]interface{}{"min": numericOrZero(n.Value), "inclusive_min": n.Op == ">=", "field": fields[0]}
+	case "<", "<=":
+		return map[string]interface{}{"max": numericOrZero(n.Value), "inclusive_max": n.Op == "<=", "field": fields[0]}
+	case "near", "pre":
+		if len(fields) == 1 {
+			return map[string]interface{}{"match_phrase": n.Value, "field": fields[0], "slop": n.Distance}
+		}
+		return map[string]interface{}{"disjuncts": bleveFieldMatchPhrases(fields, n.Value, n.Distance)}
+	default:
+		if isWildcard(n.Value) {
+			if len(fields) == 1 {
+				return map[string]interface{}{"wildcard": n.Value, "field": fields[0]}
+			}
+			return map[string]interface{}{"disjuncts": bleveFieldWildcards(fields, n.Value)}
+		}
+		if len(fields) == 1 {
+			return map[string]interface{}{"match": n.Value, "field": fields[0]}
+		}
+		return map[string]interface{}{"disjuncts": bleveFieldMatches(fields, n.Value)}
+	}
+}
+
+func numericOrZero(value string) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+func bleveFieldMatches(fields []string, value string) []interface{} {
+	out := make([]interface{}, len(fields))
+	for i, f := range fields {
+		out[i] = map[string]interface{}{"match": value, "field": f}
+	}
+	return out
+}
+
+func bleveFieldMatchPhrases(fields []string, value string, distance int) []interface{} {
+	out := make([]interface{}, len(fields))
+	for i, f := range fields {
+		out[i] = map[string]interface{}{"match_phrase": value, "field": f, "slop": distance}
+	}
+	return out
+}
+
+func bleveFieldWildcards(fields []string, value string) []interface{} {
+	out := make([]interface{}, len(fields))
+	for i, f := range fields {
+		out[i] = map[string]interface{}{"wildcard": value, "field": f}
+	}
+	return out
+}
+
+func bleveNodes(nodes []Node, fm FieldMap) []interface{} {
+	out := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		out[i] = bleveNode(n, fm)
+	}
+	return out
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+// simpleTree is a small AND/OR tree with an equality and a near field,
+// enough to exercise each Emitter's field, boolean, and proximity paths.
+func simpleTree() Node {
+	return &AndNode{Children: []Node{
+		&FieldNode{Field: "TITLE", Value: "machine learning"},
+		&FieldNode{Field: "TITLE-ABS-KEY", Value: "climate change", Op: "near", Distance: 5},
+	}}
+}
+
+func TestElasticsearchEmitter(t *testing.T) {
+	e := &ElasticsearchEmitter{FieldMap: defaultFieldMap()}
+	result, err := e.Emit(simpleTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Query == "" {
+		t.Fatal("expected a non-empty query body")
+	}
+}
+
+func TestLuceneEmitter(t *testing.T) {
+	e := &LuceneEmitter{FieldMap: defaultFieldMap()}
+	result, err := e.Emit(simpleTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Query == "" {
+		t.Fatal("expected a non-empty Lucene query string")
+	}
+}
+
+func TestSQLEmitter(t *testing.T) {
+	e := &SQLEmitter{FieldMap: defaultFieldMap()}
+	result, err := e.Emit(simpleTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Query == "" {
+		t.Fatal("expected a non-empty WHERE clause")
+	}
+	if len(result.Args) == 0 {
+		t.Fatal("expected positional args for the parameterized clause")
+	}
+}
+
+func TestBleveEmitter(t *testing.T) {
+	e := &BleveEmitter{FieldMap: defaultFieldMap()}
+	result, err := e.Emit(simpleTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Query == "" {
+		t.Fatal("expected a non-empty Bleve query JSON")
+	}
+}
+
+func TestNewEmitterUnknownTarget(t *testing.T) {
+	if _, err := NewEmitter("nonsense", defaultFieldMap()); err == nil {
+		t.Fatal("expected an error for an unknown target")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+// ParseError carries enough position information for a tool (or a human)
+// to locate why a line failed to parse, rather than just a bare message.
+// Column is the 1-based column cause pointed at, when cause could report
+// one (see columnError); otherwise it defaults to 1.
+type ParseError struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Snippet string `json:"snippet"`
+	Message string `json:"message"`
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s (near %q)", e.Line, e.Column, e.Message, e.Snippet)
+}
+
+// columnError is implemented by errors that can report the 1-based
+// column in the source query where they occurred, e.g. the error Compile
+// returns when tokenize couldn't recognize part of the query.
+type columnError interface {
+	Position() int
+}
+
+// positionedError is a columnError: a message paired with the column in
+// the source query it was produced from.
+type positionedError struct {
+	message  string
+	position int
+}
+
+func (e *positionedError) Error() string { return e.message }
+func (e *positionedError) Position() int { return e.position }
+
+// newParseError builds a ParseError for a failing line, trimming the
+// snippet so long queries don't blow up the .errors.jsonl side-channel.
+// Column comes from cause when it's a columnError, else defaults to 1.
+func newParseError(line int, query string, cause error) *ParseError {
+	const maxSnippet = 60
+	snippet := query
+	if len(snippet) > maxSnippet {
+		snippet = snippet[:maxSnippet] + "..."
+	}
+	column := 1
+	if ce, ok := cause.(columnError); ok {
+		column = ce.Position()
+	}
+	return &ParseError{
+		Line:    line,
+		Column:  column,
+		Snippet: snippet,
+		Message: cause.Error(),
+	}
+}
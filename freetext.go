@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// freeTextTermRe matches one "term" of a google-style free-text query: an
+// optional leading +/- modifier, an optional field qualifier, and either a
+// quoted phrase or a bare word. Parentheses are matched on their own.
+var freeTextTermRe = regexp.MustCompile(`\(|\)|[+-]?[A-Za-z0-9_]+:"[^"]*"|[+-]?[A-Za-z0-9_]+:[^\s()]+|[+-]?"[^"]*"|[+-]?[^\s()]+`)
+
+// freeTextFieldRe splits a term body (modifier already stripped) into an
+// optional field qualifier and its value, e.g. `title:"deep learning"` or
+// `author:smith`.
+var freeTextFieldRe = regexp.MustCompile(`^([A-Za-z0-9_]+):"?([^"]*?)"?$`)
+
+// tokenizeFreeText lexes a google-style free-text query
+// (`+required -excluded field:term "quoted phrase"`) into the same Token
+// stream used by the SDG parser, so parseTokens can build the ParsedQuery
+// tree without any changes.
+func tokenizeFreeText(query string) []Token {
+	var tokens []Token
+
+	raws := freeTextTermRe.FindAllString(query, -1)
+	for _, raw := range raws {
+		switch raw {
+		case "(":
+			tokens = append(tokens, Token{Type: TokenOpenParen, Value: raw})
+			continue
+		case ")":
+			tokens = append(tokens, Token{Type: TokenCloseParen, Value: raw})
+			continue
+		}
+
+		modifier := TokenAND
+		body := raw
+		switch raw[0] {
+		case '+':
+			body = raw[1:]
+		case '-':
+			modifier = TokenANDNOT
+			body = raw[1:]
+		}
+		if body == "" {
+			continue
+		}
+
+		field, value := "ANY", strings.Trim(body, `"`)
+		if m := freeTextFieldRe.FindStringSubmatch(body); m != nil {
+			field, value = strings.ToUpper(m[1]), m[2]
+		}
+		if value == "" {
+			continue
+		}
+
+		// Every term carries its own implicit operator (AND unless negated),
+		// rather than inheriting whatever operator preceded it.
+		if last := len(tokens) - 1; last >= 0 && tokens[last].Type != TokenOpenParen {
+			tokens = append(tokens, Token{Type: modifier, Value: "AND"})
+		} else if modifier == TokenANDNOT {
+			tokens = append(tokens, Token{Type: modifier, Value: "AND"})
+		}
+
+		tokens = append(tokens, Token{Type: TokenField, Value: field + ":" + value})
+	}
+
+	return tokens
+}
+
+// processFreeTextQuery parses a google-style free-text query string into the
+// same ParsedQuery shape produced by processQuery, giving callers a second,
+// simpler front-end alongside the Scopus-style SDG syntax.
+func processFreeTextQuery(query string) (*ParsedQuery, error) {
+	tokens := tokenizeFreeText(query)
+	parsedQuery := parseTokens(tokens)
+	if isEmptyQuery(parsedQuery) {
+		return nil, fmt.Errorf("query parsed to empty structure")
+	}
+	return parsedQuery, nil
+}
@@ -1,12 +1,11 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -20,13 +19,26 @@ const (
 )
 
 type Token struct {
-	Type  int
+	Type int
+	// Value holds "FIELD:VALUE" for TokenField tokens, or the literal
+	// keyword/punctuation text otherwise.
 	Value string
+	// Op and Distance carry the richer leaf shapes (range comparisons and
+	// proximity) through to the Field built in parseTokens. They are left
+	// zero for a plain equality field.
+	Op       string
+	Distance int
 }
 
 type Field struct {
 	Field string `json:"field"`
 	Value string `json:"value"`
+	// Op is the comparison for range fields (">", "<", ">=", "<=", "="),
+	// "near" for an unordered W/N proximity match, "pre" for an ordered
+	// PRE/N proximity match; empty means a plain equality match.
+	Op string `json:"op,omitempty"`
+	// Distance is the W/N or PRE/N window for a proximity match.
+	Distance int `json:"distance,omitempty"`
 }
 
 type ParsedQuery struct {
@@ -103,7 +115,13 @@ func cleanupQuery(query *ParsedQuery) *ParsedQuery {
 	return cleaned
 }
 
-func tokenize(query string) []Token {
+// tokenize splits query into Tokens, also returning the 1-based column
+// (within the query string as tokenize normalizes it, i.e. after the
+// paren/keyword whitespace fix-ups above) of the first stretch of input
+// no regex alternative recognized, or 0 if every character was consumed
+// by some token. Compile surfaces that column in the ParseError it
+// produces when tokenizing leaves nothing parseable.
+func tokenize(query string) ([]Token, int) {
 	var tokens []Token
 
 	// Balance parentheses
@@ -119,10 +137,30 @@ func tokenize(query string) []Token {
 	query = strings.ReplaceAll(query, " AND ", " AND ")
 	query = strings.ReplaceAll(query, " OR ", " OR ")
 
-	re := regexp.MustCompile(`(TITLE-ABS-KEY|TITLE-ABS|TITLE|AUTHKEY)\s*\("([^"]+?)"\)|OR|AND_NOT|AND|\(|\)|"([^"]+?)"`)
+	re := regexp.MustCompile(`(?:TITLE-ABS-KEY|TITLE-ABS|TITLE|AUTHKEY)\s*\("[^"]+?"\)(?:\s*(?:W|PRE)/\d+)?|PUBYEAR\s*(?:>=|<=|>|<|=)\s*\d+|PUBYEAR\s+IS\s+\d+|OR|AND_NOT|AND|\(|\)|"[^"]+?"(?:\s*(?:W|PRE)/\d+)?|[A-Za-z][A-Za-z0-9]*[*?][A-Za-z0-9*?]*`)
 	matches := re.FindAllStringSubmatchIndex(query, -1)
 
+	pubyearCmpRe := regexp.MustCompile(`^PUBYEAR\s*(>=|<=|>|<|=)\s*(\d+)$`)
+	pubyearIsRe := regexp.MustCompile(`^PUBYEAR\s+IS\s+(\d+)$`)
+	fieldParenRe := regexp.MustCompile(`(TITLE-ABS-KEY|TITLE-ABS|TITLE|AUTHKEY)\s*\("((?:[^"\\]|\\.)+)"\)(?:\s*(W|PRE)/(\d+))?`)
+	quotedPhraseRe := regexp.MustCompile(`^"([^"]+?)"(?:\s*(W|PRE)/(\d+))?$`)
+	wildcardRe := regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*[*?][A-Za-z0-9*?]*$`)
+
+	badPos := 0
+	cursor := 0
+	recordGap := func(end int) {
+		if badPos != 0 || end <= cursor {
+			return
+		}
+		gap := query[cursor:end]
+		if trimmed := strings.TrimSpace(gap); trimmed != "" {
+			badPos = cursor + strings.Index(gap, trimmed) + 1
+		}
+	}
+
 	for matchIndex, match := range matches {
+		recordGap(match[0])
+		cursor = match[1]
 		fullMatch := strings.TrimSpace(query[match[0]:match[1]])
 		var token Token
 
@@ -138,19 +176,26 @@ func tokenize(query string) []Token {
 		case fullMatch == ")":
 			token = Token{Type: TokenCloseParen, Value: fullMatch}
 		default:
-			if strings.Contains(fullMatch, "(") {
-				re := regexp.MustCompile(`(TITLE-ABS-KEY|TITLE-ABS|TITLE|AUTHKEY)\s*\("((?:[^"\\]|\\.)+)"\)`)
-				if subMatches := re.FindStringSubmatch(fullMatch); len(subMatches) == 3 {
-					token = Token{
-						Type:  TokenField,
-						Value: fmt.Sprintf("%s:%s", subMatches[1], subMatches[2]),
+			if subMatches := pubyearCmpRe.FindStringSubmatch(fullMatch); subMatches != nil {
+				token = Token{Type: TokenField, Value: fmt.Sprintf("PUBYEAR:%s", subMatches[2]), Op: subMatches[1]}
+			} else if subMatches := pubyearIsRe.FindStringSubmatch(fullMatch); subMatches != nil {
+				token = Token{Type: TokenField, Value: fmt.Sprintf("PUBYEAR:%s", subMatches[1]), Op: "="}
+			} else if strings.Contains(fullMatch, "(") {
+				if subMatches := fieldParenRe.FindStringSubmatch(fullMatch); len(subMatches) == 5 {
+					token = Token{Type: TokenField, Value: fmt.Sprintf("%s:%s", subMatches[1], subMatches[2])}
+					if subMatches[3] != "" {
+						token.Op = proximityOp(subMatches[3])
+						token.Distance, _ = strconv.Atoi(subMatches[4])
 					}
 				}
-			} else if strings.HasPrefix(fullMatch, `"`) && strings.HasSuffix(fullMatch, `"`) {
-				token = Token{
-					Type:  TokenField,
-					Value: fmt.Sprintf("ANY:%s", strings.Trim(fullMatch, `"`)),
+			} else if subMatches := quotedPhraseRe.FindStringSubmatch(fullMatch); subMatches != nil {
+				token = Token{Type: TokenField, Value: fmt.Sprintf("ANY:%s", subMatches[1])}
+				if subMatches[2] != "" {
+					token.Op = proximityOp(subMatches[2])
+					token.Distance, _ = strconv.Atoi(subMatches[3])
 				}
+			} else if wildcardRe.MatchString(fullMatch) {
+				token = Token{Type: TokenField, Value: fmt.Sprintf("ANY:%s", fullMatch)}
 			}
 		}
 
@@ -170,7 +215,19 @@ func tokenize(query string) []Token {
 			}
 		}
 	}
-	return tokens
+	recordGap(len(query))
+	return tokens, badPos
+}
+
+// proximityOp maps the captured "W" or "PRE" keyword to the Field.Op
+// that distinguishes them: "near" is unordered (the terms can appear in
+// either order within Distance words), "pre" additionally requires them
+// in the order written.
+func proximityOp(keyword string) string {
+	if keyword == "PRE" {
+		return "pre"
+	}
+	return "near"
 }
 
 func parseTokens(tokens []Token) *ParsedQuery {
@@ -185,15 +242,20 @@ func parseTokens(tokens []Token) *ParsedQuery {
 	for _, token := range tokens {
 		switch token.Type {
 		case TokenField:
-			parts := strings.Split(token.Value, ":")
+			// SplitN: a field's value can itself contain colons (a URL, a
+			// DOI, a quoted phrase with a colon in it), so only the first
+			// colon separates field from value.
+			parts := strings.SplitN(token.Value, ":", 2)
 			if len(parts) != 2 {
 				continue
 			}
 
 			fieldQuery := ParsedQuery{
 				Field: &Field{
-					Field: parts[0],
-					Value: parts[1],
+					Field:    parts[0],
+					Value:    parts[1],
+					Op:       token.Op,
+					Distance: token.Distance,
 				},
 			}
 
@@ -238,75 +300,61 @@ func parseTokens(tokens []Token) *ParsedQuery {
 	return cleanupQuery(current.query)
 }
 
-func processQuery(query string) (*ParsedQuery, error) {
-	tokens := tokenize(query)
-	parsedQuery := parseTokens(tokens)
-	if isEmptyQuery(parsedQuery) {
-		return nil, fmt.Errorf("query parsed to empty structure")
-	}
-	return parsedQuery, nil
-}
-
-func processFile(inputPath string) error {
-	file, err := os.Open(inputPath)
+func processQuery(query string, opts ...NormalizeOption) (*ParsedQuery, error) {
+	node, err := Compile(query)
 	if err != nil {
-		return fmt.Errorf("error opening input file: %v", err)
+		return nil, err
 	}
-	defer file.Close()
 
-	outputPath := strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + ".json"
-	outputFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("error creating output file: %v", err)
+	var options normalizeOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.level != NormalizeNone {
+		node = Normalize(node, options.level)
 	}
-	defer outputFile.Close()
-
-	var allQueries []ParsedQuery
-	scanner := bufio.NewScanner(file)
-	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
-
-	lineNumber := 0
-	for scanner.Scan() {
-		lineNumber++
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
 
-		parsedQuery, err := processQuery(line)
-		if err != nil {
-			fmt.Printf("Warning: Error processing line %d: %v\n", lineNumber, err)
-			continue
-		}
+	return parsedQueryFromNode(node), nil
+}
 
-		if !isEmptyQuery(parsedQuery) {
-			allQueries = append(allQueries, *parsedQuery)
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "allowlist":
+			if err := runAllowlist(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "serve":
+			if err := runServe(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading input file: %v", err)
-	}
-
-	encoder := json.NewEncoder(outputFile)
-	encoder.SetIndent("", "  ")
+	target := flag.String("target", "json", "output target: json, elasticsearch, lucene, sql, or bleve")
+	fieldMapPath := flag.String("fieldmap", "", "path to a JSON field map config overriding the default field mappings")
+	workers := flag.Int("workers", 4, "number of lines to parse concurrently")
+	failFast := flag.Bool("fail-fast", false, "exit non-zero if any line fails to parse")
+	flag.Parse()
 
-	if err := encoder.Encode(allQueries); err != nil {
-		return fmt.Errorf("error writing JSON to file: %v", err)
+	if flag.NArg() != 1 {
+		fmt.Println("Usage: go run . [-target=json|elasticsearch|lucene|sql|bleve] [-fieldmap=path] [-workers=N] [-fail-fast] <input_file.txt>")
+		fmt.Println("       go run . allowlist [-out=allow.list] <input_file.txt>")
+		fmt.Println("       go run . serve [-allow=allow.list] [-addr=:8080]")
+		os.Exit(1)
 	}
 
-	fmt.Printf("Successfully processed %d queries. Output written to: %s\n", len(allQueries), outputPath)
-	return nil
-}
-
-func main() {
-	if len(os.Args) != 2 {
-		fmt.Println("Usage: go run main.go <input_file.txt>")
+	fieldMap, err := LoadFieldMap(*fieldMapPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	inputFile := os.Args[1]
-	if err := processFile(inputFile); err != nil {
+	if err := processFile(flag.Arg(0), *target, fieldMap, *workers, *failFast); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,280 @@
+package main
+
+import "sort"
+
+// NormalizationLevel selects how aggressively Normalize rewrites a Node
+// tree before it is serialized back to JSON. Each level includes the work
+// done by the ones before it.
+type NormalizationLevel int
+
+const (
+	// NormalizeNone leaves the tree exactly as Compile produced it.
+	NormalizeNone NormalizationLevel = iota
+	// NormalizeFlatten flattens nested same-operator nodes, drops duplicate
+	// leaves within an operator, and sorts children into a canonical order
+	// so semantically-equal queries serialize to byte-identical JSON.
+	NormalizeFlatten
+	// NormalizeDeMorgan additionally pushes negations down to the leaves
+	// via De Morgan's laws, so AND_NOT only ever wraps a leaf.
+	NormalizeDeMorgan
+	// NormalizeDNF additionally distributes AND over OR, producing a flat
+	// disjunction of conjunctions.
+	NormalizeDNF
+	// NormalizeCNF additionally distributes OR over AND, producing a flat
+	// conjunction of disjunctions. Mutually exclusive with NormalizeDNF.
+	NormalizeCNF
+)
+
+// NormalizeOption configures a Normalize call. Options compose via the
+// functional-options pattern so callers only spell out the levels they
+// care about.
+type NormalizeOption func(*normalizeOptions)
+
+type normalizeOptions struct {
+	level NormalizationLevel
+}
+
+// WithNormalization selects the normalization level processQuery applies
+// before returning a query's JSON representation.
+func WithNormalization(level NormalizationLevel) NormalizeOption {
+	return func(o *normalizeOptions) { o.level = level }
+}
+
+// Normalize rewrites a Node tree to the requested level. It never mutates
+// the input tree; it returns a new one.
+func Normalize(node Node, level NormalizationLevel) Node {
+	if node == nil || level == NormalizeNone {
+		return node
+	}
+
+	node = flatten(node)
+	if level == NormalizeFlatten {
+		return node
+	}
+
+	node = pushNegations(node)
+	if level == NormalizeDeMorgan {
+		return node
+	}
+
+	switch level {
+	case NormalizeDNF:
+		node = flatten(distribute(node, true))
+	case NormalizeCNF:
+		node = flatten(distribute(node, false))
+	}
+	return node
+}
+
+// flatten merges nested same-operator nodes, drops duplicate leaves within
+// an operator, and sorts children by their canonical string key so that
+// semantically-equal trees produce identical output.
+func flatten(node Node) Node {
+	switch n := node.(type) {
+	case *AndNode:
+		return &AndNode{Children: flattenChildren(n.Children, func(c Node) ([]Node, bool) {
+			if a, ok := c.(*AndNode); ok {
+				return a.Children, true
+			}
+			return nil, false
+		})}
+	case *OrNode:
+		return &OrNode{Children: flattenChildren(n.Children, func(c Node) ([]Node, bool) {
+			if o, ok := c.(*OrNode); ok {
+				return o.Children, true
+			}
+			return nil, false
+		})}
+	case *NotNode:
+		return &NotNode{Child: flatten(n.Child)}
+	default:
+		return node
+	}
+}
+
+// flattenChildren flattens, recursively normalizes, dedups, and canonically
+// sorts a node's children. unwrap reports whether a child is the same
+// operator as the parent and, if so, returns its grandchildren to splice in.
+func flattenChildren(children []Node, unwrap func(Node) ([]Node, bool)) []Node {
+	var flat []Node
+	for _, child := range children {
+		child = flatten(child)
+		if grandchildren, ok := unwrap(child); ok {
+			flat = append(flat, grandchildren...)
+		} else {
+			flat = append(flat, child)
+		}
+	}
+	return canonicalSort(dedupNodes(flat))
+}
+
+// dedupNodes drops leaves that are equal to an earlier one, comparing by
+// canonical key rather than String() so that operator order within a leaf
+// (there is none) can't hide a duplicate.
+func dedupNodes(nodes []Node) []Node {
+	seen := make(map[string]bool, len(nodes))
+	deduped := nodes[:0:0]
+	for _, n := range nodes {
+		key := canonicalKey(n)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, n)
+	}
+	return deduped
+}
+
+// canonicalSort orders children by their canonical key so that two trees
+// built from differently-ordered input serialize identically.
+func canonicalSort(nodes []Node) []Node {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return canonicalKey(nodes[i]) < canonicalKey(nodes[j])
+	})
+	return nodes
+}
+
+// canonicalKey returns a stable string key for a node, used for both
+// dedup and sorting. It is String() prefixed with the node's type so that,
+// say, an AndNode and an OrNode with the same rendered children never
+// collide.
+func canonicalKey(n Node) string {
+	switch n.(type) {
+	case *AndNode:
+		return "AND:" + n.String()
+	case *OrNode:
+		return "OR:" + n.String()
+	case *NotNode:
+		return "NOT:" + n.String()
+	case *RegexpNode:
+		return "RE:" + n.String()
+	default:
+		return "LEAF:" + n.String()
+	}
+}
+
+// pushNegations applies De Morgan's laws so that AND_NOT only ever wraps a
+// leaf: NOT(AND(a,b)) becomes OR(NOT(a), NOT(b)), NOT(OR(a,b)) becomes
+// AND(NOT(a), NOT(b)), and a double negation cancels out.
+func pushNegations(node Node) Node {
+	switch n := node.(type) {
+	case *NotNode:
+		switch child := pushNegations(n.Child).(type) {
+		case *NotNode:
+			return child.Child
+		case *AndNode:
+			negated := make([]Node, len(child.Children))
+			for i, c := range child.Children {
+				negated[i] = pushNegations(&NotNode{Child: c})
+			}
+			return &OrNode{Children: negated}
+		case *OrNode:
+			negated := make([]Node, len(child.Children))
+			for i, c := range child.Children {
+				negated[i] = pushNegations(&NotNode{Child: c})
+			}
+			return &AndNode{Children: negated}
+		default:
+			return &NotNode{Child: child}
+		}
+	case *AndNode:
+		children := make([]Node, len(n.Children))
+		for i, c := range n.Children {
+			children[i] = pushNegations(c)
+		}
+		return &AndNode{Children: children}
+	case *OrNode:
+		children := make([]Node, len(n.Children))
+		for i, c := range n.Children {
+			children[i] = pushNegations(c)
+		}
+		return &OrNode{Children: children}
+	default:
+		return node
+	}
+}
+
+// distribute expands a tree into disjunctive (toDNF=true) or conjunctive
+// (toDNF=false) normal form by distributing one operator over the other.
+func distribute(node Node, toDNF bool) Node {
+	switch n := node.(type) {
+	case *AndNode:
+		children := make([]Node, len(n.Children))
+		for i, c := range n.Children {
+			children[i] = distribute(c, toDNF)
+		}
+		if toDNF {
+			return distributeOver(children, func(parts []Node) Node { return &AndNode{Children: parts} }, func(parts []Node) Node { return &OrNode{Children: parts} })
+		}
+		return &AndNode{Children: children}
+	case *OrNode:
+		children := make([]Node, len(n.Children))
+		for i, c := range n.Children {
+			children[i] = distribute(c, toDNF)
+		}
+		if !toDNF {
+			return distributeOver(children, func(parts []Node) Node { return &OrNode{Children: parts} }, func(parts []Node) Node { return &AndNode{Children: parts} })
+		}
+		return &OrNode{Children: children}
+	default:
+		return node
+	}
+}
+
+// distributeOver distributes `outer` over any child built with `inner`,
+// e.g. AND(OR(a,b), c) -> OR(AND(a,c), AND(b,c)) when outer=AndNode,
+// inner=OrNode. Children with no inner-operator child are left alone.
+func distributeOver(children []Node, outer func([]Node) Node, inner func([]Node) Node) Node {
+	combos := [][]Node{{}}
+	sawInner := false
+	for _, child := range children {
+		var options []Node
+		if hasType(child, inner) {
+			sawInner = true
+			options = childrenOf(child)
+		} else {
+			options = []Node{child}
+		}
+
+		var next [][]Node
+		for _, combo := range combos {
+			for _, opt := range options {
+				extended := append(append([]Node{}, combo...), opt)
+				next = append(next, extended)
+			}
+		}
+		combos = next
+	}
+
+	if !sawInner {
+		return outer(children)
+	}
+
+	results := make([]Node, len(combos))
+	for i, combo := range combos {
+		results[i] = outer(combo)
+	}
+	return inner(results)
+}
+
+func hasType(n Node, ctor func([]Node) Node) bool {
+	switch ctor(nil).(type) {
+	case *OrNode:
+		_, ok := n.(*OrNode)
+		return ok
+	case *AndNode:
+		_, ok := n.(*AndNode)
+		return ok
+	}
+	return false
+}
+
+func childrenOf(n Node) []Node {
+	switch v := n.(type) {
+	case *OrNode:
+		return v.Children
+	case *AndNode:
+		return v.Children
+	}
+	return []Node{n}
+}
@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+// buildField is a small helper for tests that need a leaf Node without
+// going through Compile.
+func buildField(field, value string) *FieldNode {
+	return &FieldNode{Field: field, Value: value}
+}
+
+func docFor(fields ...string) map[string][]string {
+	doc := make(map[string][]string)
+	for _, f := range fields {
+		doc[f] = []string{"1"}
+	}
+	return doc
+}
+
+// roundTrip runs a Node through MarshalJSON/NodeFromJSON, mirroring what
+// every caller of Normalize does before persisting or hashing a query.
+func roundTrip(t *testing.T, n Node) Node {
+	t.Helper()
+	b, err := n.(interface{ MarshalJSON() ([]byte, error) }).MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %v", err)
+	}
+	rt, err := NodeFromJSON(b)
+	if err != nil {
+		t.Fatalf("NodeFromJSON: %v", err)
+	}
+	return rt
+}
+
+// TestNormalizeCNFRoundTrip guards against regressing the AndNode/OrNode
+// splicing bug: (A AND B) OR (C AND D) normalized to CNF must still
+// evaluate false on a doc that only satisfies one clause's half, both
+// in-memory and after a JSON round trip.
+func TestNormalizeCNFRoundTrip(t *testing.T) {
+	tree := &OrNode{Children: []Node{
+		&AndNode{Children: []Node{buildField("A", "1"), buildField("B", "1")}},
+		&AndNode{Children: []Node{buildField("C", "1"), buildField("D", "1")}},
+	}}
+
+	cnf := Normalize(tree, NormalizeCNF)
+	doc := docFor("A", "D")
+
+	if cnf.Eval(doc) {
+		t.Fatal("in-memory CNF evaluated true on a doc satisfying neither clause")
+	}
+	if rt := roundTrip(t, cnf); rt.Eval(doc) {
+		t.Fatal("round-tripped CNF evaluated true on a doc satisfying neither clause")
+	}
+}
+
+// TestNormalizeDNFRoundTrip is the DNF counterpart: (A OR B) AND (C OR D)
+// normalized to DNF must still evaluate false on a doc that can't satisfy
+// any conjunction, both in-memory and after a JSON round trip.
+func TestNormalizeDNFRoundTrip(t *testing.T) {
+	tree := &AndNode{Children: []Node{
+		&OrNode{Children: []Node{buildField("A", "1"), buildField("B", "1")}},
+		&OrNode{Children: []Node{buildField("C", "1"), buildField("D", "1")}},
+	}}
+
+	dnf := Normalize(tree, NormalizeDNF)
+	doc := docFor("A") // satisfies the first OR but not the second
+
+	if dnf.Eval(doc) {
+		t.Fatal("in-memory DNF evaluated true on a doc satisfying neither conjunction")
+	}
+	if rt := roundTrip(t, dnf); rt.Eval(doc) {
+		t.Fatal("round-tripped DNF evaluated true on a doc satisfying neither conjunction")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// resolveRequest is the body of a POST /resolve call: look a persisted
+// query up by its hash or its human-assigned name.
+type resolveRequest struct {
+	Hash string `json:"hash"`
+	Name string `json:"name"`
+}
+
+// parseRequest is the body of a POST /parse call: a raw query string that
+// is only accepted if its normalized hash is already in the allow-list.
+type parseRequest struct {
+	Query string `json:"query"`
+}
+
+// allowListServer serves the allow-list query gateway: /resolve returns a
+// persisted query's parsed JSON by hash or name, and /parse rejects any
+// query whose normalized hash isn't already on the list.
+type allowListServer struct {
+	entries map[string]AllowListEntry
+	byName  map[string]AllowListEntry
+}
+
+func newAllowListServer(entries map[string]AllowListEntry) *allowListServer {
+	byName := make(map[string]AllowListEntry, len(entries))
+	for _, entry := range entries {
+		byName[entry.Name] = entry
+	}
+	return &allowListServer{entries: entries, byName: byName}
+}
+
+func (s *allowListServer) handleResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req resolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	entry, ok := s.entries[req.Hash]
+	if !ok && req.Name != "" {
+		entry, ok = s.byName[req.Name]
+	}
+	if !ok {
+		http.Error(w, "query not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+func (s *allowListServer) handleParse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req parseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	hash, _, err := QueryHash(req.Query)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error parsing query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	entry, ok := s.entries[hash]
+	if !ok {
+		http.Error(w, "query is not in the allow list", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// runServe implements the `serve` subcommand: an HTTP query gateway
+// backed by an allow-list file.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	allowPath := fs.String("allow", "allow.list", "path to the allow-list file")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	entries, err := loadAllowList(*allowPath)
+	if err != nil {
+		return err
+	}
+
+	server := newAllowListServer(entries)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/resolve", server.handleResolve)
+	mux.HandleFunc("/parse", server.handleParse)
+
+	log.Printf("serving %d allow-listed queries on %s", len(entries), *addr)
+	return http.ListenAndServe(*addr, mux)
+}